@@ -0,0 +1,232 @@
+// Package api exposes a Store's query surface as a JSON/CSV REST API, so
+// dashboards and Grafana-style clients can consume COVID statistics over
+// HTTP instead of the CLI.
+package api
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/protopopov1122/covidservice/lib"
+	"github.com/protopopov1122/covidservice/lib/ecdc"
+)
+
+// Server exposes a Store's query operations over HTTP
+type Server struct {
+	store      lib.Store
+	env        *lib.Env
+	httpServer *http.Server
+}
+
+// NewServer constructs an API server bound to the given store/env, listening
+// on the provided address once Serve is called
+func NewServer(store lib.Store, env *lib.Env, listen string) *Server {
+	server := &Server{
+		store: store,
+		env:   env,
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/countries", server.handleCountries)
+	mux.HandleFunc("/countries/", server.handleCountry)
+	mux.HandleFunc("/records", server.handleRecords)
+	mux.HandleFunc("/import", server.handleImport)
+	server.httpServer = &http.Server{
+		Addr:    listen,
+		Handler: withMiddleware(mux),
+	}
+	return server
+}
+
+// Serve starts the HTTP server and blocks until it is shut down, returning
+// nil on a clean Shutdown
+func (server *Server) Serve() error {
+	if err := server.httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// Shutdown gracefully stops the server, waiting for in-flight requests to
+// finish until ctx is done
+func (server *Server) Shutdown(ctx context.Context) error {
+	return server.httpServer.Shutdown(ctx)
+}
+
+func (server *Server) handleCountries(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	countries, err := server.store.Countries()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(countries)
+}
+
+func (server *Server) handleCountry(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	code := strings.TrimPrefix(r.URL.Path, "/countries/")
+	if len(code) == 0 {
+		http.Error(w, "Provide country code", http.StatusBadRequest)
+		return
+	}
+	country, err := server.store.Country(code)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if country == nil {
+		http.Error(w, "Country not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(country)
+}
+
+func (server *Server) handleRecords(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	countryParam := r.URL.Query().Get("country")
+	if len(countryParam) == 0 {
+		http.Error(w, "Provide country query parameter", http.StatusBadRequest)
+		return
+	}
+	since := time.Unix(0, 0)
+	if sinceParam := r.URL.Query().Get("since"); len(sinceParam) > 0 {
+		parsed, err := time.Parse("2006-01-02", sinceParam)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid since parameter: %s", err), http.StatusBadRequest)
+			return
+		}
+		since = parsed
+	}
+	var until time.Time
+	hasUntil := false
+	if untilParam := r.URL.Query().Get("until"); len(untilParam) > 0 {
+		parsed, err := time.Parse("2006-01-02", untilParam)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid until parameter: %s", err), http.StatusBadRequest)
+			return
+		}
+		until = parsed
+		hasUntil = true
+	}
+
+	sourceParam := r.URL.Query().Get("source")
+	records, err := server.store.RetrieveRecordsSince(lib.NewQuery(countryParam), since, sourceParam)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	switch r.URL.Query().Get("format") {
+	case "csv":
+		writeRecordsCSV(w, records, until, hasUntil)
+	default:
+		writeRecordsJSON(w, records, until, hasUntil)
+	}
+}
+
+func writeRecordsJSON(w http.ResponseWriter, records chan lib.CovidStatisticsRecordResult, until time.Time, hasUntil bool) {
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprint(w, "[")
+	encoder := json.NewEncoder(w)
+	first := true
+	for record := range records {
+		if record.Error != nil {
+			continue
+		}
+		if hasUntil && record.Result.Date.After(until) {
+			continue
+		}
+		if !first {
+			fmt.Fprint(w, ",")
+		}
+		first = false
+		encoder.Encode(record.Result)
+	}
+	fmt.Fprint(w, "]")
+}
+
+func writeRecordsCSV(w http.ResponseWriter, records chan lib.CovidStatisticsRecordResult, until time.Time, hasUntil bool) {
+	w.Header().Set("Content-Type", "text/csv")
+	writer := csv.NewWriter(w)
+	defer writer.Flush()
+	writer.Write([]string{"Country", "Date", "Cumulative", "Cases", "Deaths"})
+	for record := range records {
+		if record.Error != nil {
+			continue
+		}
+		if hasUntil && record.Result.Date.After(until) {
+			continue
+		}
+		writer.Write([]string{
+			record.Result.Country.Code,
+			record.Result.Date.Format("2006-01-02"),
+			strconv.FormatFloat(record.Result.Cumulative, 'f', -1, 64),
+			strconv.Itoa(record.Result.Cases),
+			strconv.Itoa(record.Result.Deaths),
+		})
+	}
+}
+
+func (server *Server) handleImport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	dataSource, err := ecdc.NewDataSource(server.env.EcdcDataSourceURL)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	if err := dataSource.Import(server.store); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+type contextKey int
+
+const requestIDKey contextKey = iota
+
+var requestCounter uint64
+
+func withMiddleware(next http.Handler) http.Handler {
+	return requestIDMiddleware(accessLogMiddleware(next))
+}
+
+func requestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := fmt.Sprintf("%d-%d", time.Now().UnixNano(), atomic.AddUint64(&requestCounter, 1))
+		w.Header().Set("X-Request-Id", requestID)
+		ctx := context.WithValue(r.Context(), requestIDKey, requestID)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func accessLogMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		next.ServeHTTP(w, r)
+		requestID, _ := r.Context().Value(requestIDKey).(string)
+		log.Printf("[%s] %s %s %s", requestID, r.Method, r.URL.Path, time.Since(start))
+	})
+}
@@ -7,13 +7,13 @@ import (
 )
 
 // EntryFn defines application entry point
-type EntryFn func(cdb *Database, env *Env, out io.Writer) error
+type EntryFn func(cdb Store, env *Env, out io.Writer) error
 
 // CliCommand defines a signle command line command
 type CliCommand interface {
 	Mnemonic() string
 	Description() string
-	Execute(cdb *Database, env *Env, cli *Cli, argv []string, out io.Writer) error
+	Execute(cdb Store, env *Env, cli *Cli, argv []string, out io.Writer) error
 }
 
 // Cli defines command line interface
@@ -24,7 +24,7 @@ type Cli struct {
 type commandImpl struct {
 	mnemonic    string
 	description string
-	callback    func(cdb *Database, env *Env, cli *Cli, argv []string, out io.Writer) error
+	callback    func(cdb Store, env *Env, cli *Cli, argv []string, out io.Writer) error
 }
 
 // NewCli constructs command line interface instance
@@ -44,7 +44,7 @@ func (cli *Cli) Bind(cmd CliCommand) error {
 }
 
 // Execute invokes command line according to provided arguments
-func (cli *Cli) Execute(cdb *Database, env *Env, argv []string, out io.Writer) error {
+func (cli *Cli) Execute(cdb Store, env *Env, argv []string, out io.Writer) error {
 	if len(argv) == 0 {
 		return errors.New("No command supplied")
 	}
@@ -58,7 +58,7 @@ func (cli *Cli) Execute(cdb *Database, env *Env, argv []string, out io.Writer) e
 
 // NewEntry constructs entry point for provided command line arguments
 func (cli *Cli) NewEntry(argv []string) EntryFn {
-	return func(cdb *Database, env *Env, out io.Writer) error {
+	return func(cdb Store, env *Env, out io.Writer) error {
 		return cli.Execute(cdb, env, argv, out)
 	}
 }
@@ -71,7 +71,7 @@ func (cli *Cli) PrintCommands(out io.Writer) {
 }
 
 // NewCommand constructs standard command
-func NewCommand(mnemonic string, description string, callback func(cdb *Database, env *Env, cli *Cli, argv []string, out io.Writer) error) CliCommand {
+func NewCommand(mnemonic string, description string, callback func(cdb Store, env *Env, cli *Cli, argv []string, out io.Writer) error) CliCommand {
 	return &commandImpl{
 		mnemonic:    mnemonic,
 		description: description,
@@ -90,6 +90,6 @@ func (cmd *commandImpl) Description() string {
 }
 
 // Execute runs command callback
-func (cmd *commandImpl) Execute(cdb *Database, env *Env, cli *Cli, argv []string, out io.Writer) error {
+func (cmd *commandImpl) Execute(cdb Store, env *Env, cli *Cli, argv []string, out io.Writer) error {
 	return cmd.callback(cdb, env, cli, argv, out)
 }
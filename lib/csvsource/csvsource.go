@@ -0,0 +1,242 @@
+// Package csvsource implements lib.CovidDataSource on top of encoding/csv, so
+// long-format CSV exports (one row per country and date), such as ECDC's
+// historical dataset, can be imported alongside the JSON ECDC feed. Wide
+// layouts with one column per date, such as JHU CSSE's time series, are not
+// supported.
+package csvsource
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/protopopov1122/covidservice/lib"
+)
+
+// ColumnMap describes which CSV columns hold each field, so the importer can
+// be pointed at ECDC's historical export, a long-format JHU-derived dataset,
+// or an arbitrary national dataset. Date must name a single column holding
+// each row's date. CountryName, GeoID, Population and Continent are optional:
+// a missing CountryName or GeoID column falls back to the CountryCode value,
+// a missing Population column to 0 and a missing Continent column to "".
+type ColumnMap struct {
+	Date        string
+	CountryCode string
+	CountryName string
+	GeoID       string
+	Cases       string
+	Deaths      string
+	Population  string
+	Continent   string
+	DateLayout  string
+}
+
+// Presets holds column mappings for well-known public datasets
+var Presets = map[string]ColumnMap{
+	"ecdc": {
+		Date:        "dateRep",
+		CountryCode: "countryterritoryCode",
+		CountryName: "countriesAndTerritories",
+		GeoID:       "geoId",
+		Cases:       "cases",
+		Deaths:      "deaths",
+		Population:  "popData2019",
+		Continent:   "continentExp",
+		DateLayout:  "02/01/2006",
+	},
+	"jhu": {
+		Date:        "Date",
+		CountryCode: "Country/Region",
+		CountryName: "Country/Region",
+		Cases:       "Confirmed",
+		Deaths:      "Deaths",
+		DateLayout:  "2006-01-02",
+	},
+}
+
+// DataSource is a CSV-based lib.CovidDataSource, reading either a local file
+// or an HTTP(S) URL
+type DataSource struct {
+	location   string
+	columnMap  ColumnMap
+	sourceName string
+}
+
+// NewDataSource constructs a CSV COVID data source pointed at a local file
+// path or an HTTP(S) URL. sourceName identifies the provider for provenance
+// (e.g. "ecdc", "jhu", or a custom dataset name).
+func NewDataSource(location string, columnMap ColumnMap, sourceName string) *DataSource {
+	return &DataSource{
+		location:   location,
+		columnMap:  columnMap,
+		sourceName: sourceName,
+	}
+}
+
+func (ds *DataSource) open() (io.ReadCloser, error) {
+	if strings.HasPrefix(ds.location, "http://") || strings.HasPrefix(ds.location, "https://") {
+		rsp, err := http.Get(ds.location)
+		if err != nil {
+			return nil, err
+		}
+		return rsp.Body, nil
+	}
+	return os.Open(ds.location)
+}
+
+// Import streams the CSV source row by row into db, skipping rows already
+// covered by LastRecordDate so re-imports only append newer data
+func (ds *DataSource) Import(db lib.Store) error {
+	r, err := ds.open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	source, err := db.PutSource(ds.sourceName, ds.location)
+	if err != nil {
+		return err
+	}
+	importer := &csvImporter{
+		db:              db,
+		source:          source,
+		columnMap:       ds.columnMap,
+		lastRecordCache: make(map[string]time.Time),
+	}
+	return importer.Import(r)
+}
+
+type csvImporter struct {
+	db              lib.Store
+	source          *lib.Source
+	columnMap       ColumnMap
+	lastRecordCache map[string]time.Time
+}
+
+func (importer *csvImporter) lastRecordTime(countryCode string) (time.Time, error) {
+	if cached, ok := importer.lastRecordCache[countryCode]; ok {
+		return cached, nil
+	}
+	timestamp, err := importer.db.LastRecordDate(countryCode, importer.source.Name)
+	if err != nil {
+		return time.Unix(0, 0), err
+	}
+	importer.lastRecordCache[countryCode] = timestamp
+	return timestamp, nil
+}
+
+func (importer *csvImporter) Import(r io.Reader) error {
+	reader := csv.NewReader(r)
+	reader.ReuseRecord = true
+	header, err := reader.Read()
+	if err != nil {
+		return err
+	}
+	columnIndex := make(map[string]int, len(header))
+	for i, name := range header {
+		columnIndex[name] = i
+	}
+	resolve := func(name string) (int, error) {
+		i, ok := columnIndex[name]
+		if !ok {
+			return 0, fmt.Errorf("column '%s' not found in CSV header", name)
+		}
+		return i, nil
+	}
+
+	dateIdx, err := resolve(importer.columnMap.Date)
+	if err != nil {
+		return err
+	}
+	countryCodeIdx, err := resolve(importer.columnMap.CountryCode)
+	if err != nil {
+		return err
+	}
+	casesIdx, err := resolve(importer.columnMap.Cases)
+	if err != nil {
+		return err
+	}
+	deathsIdx, err := resolve(importer.columnMap.Deaths)
+	if err != nil {
+		return err
+	}
+	countryNameIdx, hasCountryName := columnIndex[importer.columnMap.CountryName]
+	geoIDIdx, hasGeoID := columnIndex[importer.columnMap.GeoID]
+	populationIdx, hasPopulation := columnIndex[importer.columnMap.Population]
+	continentIdx, hasContinent := columnIndex[importer.columnMap.Continent]
+
+	dateLayout := importer.columnMap.DateLayout
+	if dateLayout == "" {
+		dateLayout = "2006-01-02"
+	}
+
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		timestamp, err := time.ParseInLocation(dateLayout, row[dateIdx], time.Local)
+		if err != nil {
+			return err
+		}
+		countryCode := row[countryCodeIdx]
+		lastRecord, err := importer.lastRecordTime(countryCode)
+		if err != nil {
+			return err
+		}
+		if !lastRecord.Before(timestamp) {
+			continue
+		}
+
+		cases, err := strconv.Atoi(row[casesIdx])
+		if err != nil {
+			return err
+		}
+		deaths, err := strconv.Atoi(row[deathsIdx])
+		if err != nil {
+			return err
+		}
+		countryName := countryCode
+		if hasCountryName {
+			countryName = row[countryNameIdx]
+		}
+		geoID := countryCode
+		if hasGeoID {
+			geoID = row[geoIDIdx]
+		}
+		var population int64
+		if hasPopulation && len(row[populationIdx]) > 0 {
+			population, err = strconv.ParseInt(row[populationIdx], 10, 64)
+			if err != nil {
+				return err
+			}
+		}
+		continent := ""
+		if hasContinent {
+			continent = row[continentIdx]
+		}
+
+		country, err := importer.db.PutCountry(countryCode, geoID, countryName, population, continent)
+		if err != nil {
+			return err
+		}
+		if err := importer.db.NewRecord(&lib.CovidStatisticsRecord{
+			Country: country,
+			Date:    timestamp,
+			Cases:   cases,
+			Deaths:  deaths,
+		}, importer.source); err != nil {
+			return err
+		}
+		importer.lastRecordCache[countryCode] = timestamp
+	}
+	return nil
+}
@@ -32,8 +32,10 @@ type Records struct {
 }
 
 type ecdcImporter struct {
-	db              *lib.Database
+	db              lib.Store
+	url             string
 	records         *Records
+	source          *lib.Source
 	lastRecordCache map[string]time.Time
 }
 
@@ -93,9 +95,10 @@ func NewDataSource(url string) (*DataSource, error) {
 }
 
 // Import imports data into database
-func (ecdc *DataSource) Import(db *lib.Database) error {
+func (ecdc *DataSource) Import(db lib.Store) error {
 	importer := ecdcImporter{
 		db:              db,
+		url:             ecdc.url,
 		records:         ecdc.records,
 		lastRecordCache: make(map[string]time.Time),
 	}
@@ -103,6 +106,11 @@ func (ecdc *DataSource) Import(db *lib.Database) error {
 }
 
 func (importer *ecdcImporter) Import() error {
+	source, err := importer.db.PutSource("ecdc", importer.url)
+	if err != nil {
+		return err
+	}
+	importer.source = source
 	var recordsForImport []lib.CovidStatisticsRecord
 	for _, record := range importer.records.Records {
 		lastRecord, err := importer.lastRecordTime(record.CountryCode)
@@ -135,13 +143,13 @@ func (importer *ecdcImporter) Import() error {
 			Cumulative: cumulative,
 		})
 	}
-	return importer.db.ImportRecords(recordsForImport)
+	return importer.db.ImportRecords(recordsForImport, source)
 }
 
 func (importer *ecdcImporter) lastRecordTime(countryCode string) (time.Time, error) {
 	_, ok := importer.lastRecordCache[countryCode]
 	if !ok {
-		timestamp, err := importer.db.LastRecordDate(countryCode)
+		timestamp, err := importer.db.LastRecordDate(countryCode, importer.source.Name)
 		if err != nil {
 			return time.Unix(0, 0), err
 		}
@@ -9,12 +9,15 @@ import (
 // Env contains basic application data passed in environment variables
 type Env struct {
 	DatabasePath      string
+	DatabaseDriver    string
+	DatabaseDSN       string
 	EcdcDataSourceURL string
 }
 
 // NewDefaultEnv initialized Env with default values
 func NewDefaultEnv(ecdcURL string) (*Env, error) {
 	env := &Env{
+		DatabaseDriver:    "sqlite3",
 		EcdcDataSourceURL: ecdcURL,
 	}
 	if xdgDataHome := os.Getenv("XDG_DATA_HOME"); len(xdgDataHome) > 0 {
@@ -32,6 +35,12 @@ func (env *Env) Load() {
 	if dbPath := os.Getenv("COVID_DB_PATH"); len(dbPath) > 0 {
 		env.DatabasePath = dbPath
 	}
+	if dbDriver := os.Getenv("COVID_DB_DRIVER"); len(dbDriver) > 0 {
+		env.DatabaseDriver = dbDriver
+	}
+	if dbDSN := os.Getenv("COVID_DB_DSN"); len(dbDSN) > 0 {
+		env.DatabaseDSN = dbDSN
+	}
 	if ecdcURL := os.Getenv("COVID_ECDC_URL"); len(ecdcURL) > 0 {
 		env.EcdcDataSourceURL = ecdcURL
 	}
@@ -0,0 +1,174 @@
+// Package jhu implements lib.CovidDataSource on top of the Johns Hopkins CSSE
+// time series CSV exports (time_series_covid19_confirmed_global.csv and
+// time_series_covid19_deaths_global.csv). Unlike ECDC's long format, JHU
+// ships one column per date holding cumulative totals, with one row per
+// province/state, so provinces are summed per country and the running totals
+// are diffed into daily new cases/deaths before import.
+package jhu
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/protopopov1122/covidservice/lib"
+)
+
+const dateLayout = "1/2/06"
+
+// DataSource is a JHU CSSE time series lib.CovidDataSource, reading the
+// confirmed-cases and deaths CSV exports, each a local file path or an
+// HTTP(S) URL
+type DataSource struct {
+	confirmedLocation string
+	deathsLocation    string
+}
+
+// NewDataSource constructs a JHU CSSE data source from the confirmed-cases
+// and deaths time series locations
+func NewDataSource(confirmedLocation string, deathsLocation string) *DataSource {
+	return &DataSource{
+		confirmedLocation: confirmedLocation,
+		deathsLocation:    deathsLocation,
+	}
+}
+
+func open(location string) (io.ReadCloser, error) {
+	if strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://") {
+		rsp, err := http.Get(location)
+		if err != nil {
+			return nil, err
+		}
+		return rsp.Body, nil
+	}
+	return os.Open(location)
+}
+
+// series holds per-country cumulative totals keyed by date, in chronological order
+type series struct {
+	dates  []time.Time
+	byDate map[string]int64
+}
+
+func parseSeries(r io.Reader) (map[string]*series, []time.Time, error) {
+	reader := csv.NewReader(r)
+	header, err := reader.Read()
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(header) < 5 {
+		return nil, nil, fmt.Errorf("unexpected JHU CSSE header: %v", header)
+	}
+	dates := make([]time.Time, len(header)-4)
+	for i, column := range header[4:] {
+		parsed, err := time.ParseInLocation(dateLayout, column, time.Local)
+		if err != nil {
+			return nil, nil, err
+		}
+		dates[i] = parsed
+	}
+
+	result := make(map[string]*series)
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		country := row[1]
+		s, ok := result[country]
+		if !ok {
+			s = &series{dates: dates, byDate: make(map[string]int64, len(dates))}
+			result[country] = s
+		}
+		for i, value := range row[4:] {
+			if len(value) == 0 {
+				continue
+			}
+			count, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return nil, nil, err
+			}
+			s.byDate[dates[i].Format("2006-01-02")] += count
+		}
+	}
+	return result, dates, nil
+}
+
+// Import streams the confirmed and deaths time series into db, diffing
+// cumulative totals into daily new cases/deaths and skipping dates already
+// covered by LastRecordDate
+func (jhu *DataSource) Import(db lib.Store) error {
+	confirmedReader, err := open(jhu.confirmedLocation)
+	if err != nil {
+		return err
+	}
+	defer confirmedReader.Close()
+	confirmed, dates, err := parseSeries(confirmedReader)
+	if err != nil {
+		return err
+	}
+
+	deathsReader, err := open(jhu.deathsLocation)
+	if err != nil {
+		return err
+	}
+	defer deathsReader.Close()
+	deaths, _, err := parseSeries(deathsReader)
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(dates, func(i, j int) bool { return dates[i].Before(dates[j]) })
+
+	source, err := db.PutSource("jhu", jhu.confirmedLocation)
+	if err != nil {
+		return err
+	}
+
+	var recordsForImport []lib.CovidStatisticsRecord
+	for countryName, confirmedSeries := range confirmed {
+		// JHU CSSE ships country names rather than ISO codes in this minimal
+		// export; use the name itself as the code until a proper mapping exists.
+		country, err := db.PutCountry(countryName, countryName, countryName, 0, "")
+		if err != nil {
+			return err
+		}
+		lastRecord, err := db.LastRecordDate(countryName, source.Name)
+		if err != nil {
+			return err
+		}
+		deathsSeries := deaths[countryName]
+		var previousConfirmed, previousDeaths int64
+		for _, date := range dates {
+			key := date.Format("2006-01-02")
+			cumulativeConfirmed := confirmedSeries.byDate[key]
+			var cumulativeDeaths int64
+			if deathsSeries != nil {
+				cumulativeDeaths = deathsSeries.byDate[key]
+			}
+			newCases := cumulativeConfirmed - previousConfirmed
+			newDeaths := cumulativeDeaths - previousDeaths
+			previousConfirmed = cumulativeConfirmed
+			previousDeaths = cumulativeDeaths
+			if !lastRecord.Before(date) {
+				continue
+			}
+			recordsForImport = append(recordsForImport, lib.CovidStatisticsRecord{
+				Country: country,
+				Date:    date,
+				Cases:   int(newCases),
+				Deaths:  int(newDeaths),
+			})
+		}
+	}
+	return db.ImportRecords(recordsForImport, source)
+}
@@ -0,0 +1,43 @@
+package migrations
+
+import "database/sql"
+
+func init() {
+	Register(Migration{
+		Version:     1,
+		Description: "create Countries and Cases tables",
+		Up:          up0001,
+		Down:        down0001,
+	})
+}
+
+func up0001(tx *sql.Tx) error {
+	if _, err := tx.Exec(`CREATE TABLE IF NOT EXISTS Countries (
+		Id INTEGER PRIMARY KEY AUTOINCREMENT,
+		Code CHAR(3),
+		GeoId CHAR(2),
+		Name VARCHAR(255) COLLATE NOCASE,
+		Population INTEGER,
+		Continent VARCHAR(32)
+	)`); err != nil {
+		return err
+	}
+	_, err := tx.Exec(`CREATE TABLE IF NOT EXISTS Cases (
+		Date INTEGER,
+		CountryId INTEGER,
+		Cases INTEGER,
+		Deaths INTEGER,
+		Cumulative REAL,
+		PRIMARY KEY (Date, CountryId),
+		FOREIGN KEY (CountryId) REFERENCES Countries(Id)
+	)`)
+	return err
+}
+
+func down0001(tx *sql.Tx) error {
+	if _, err := tx.Exec(`DROP TABLE Cases`); err != nil {
+		return err
+	}
+	_, err := tx.Exec(`DROP TABLE Countries`)
+	return err
+}
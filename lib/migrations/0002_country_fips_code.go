@@ -0,0 +1,95 @@
+package migrations
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"io"
+	"strings"
+)
+
+func init() {
+	Register(Migration{
+		Version:     2,
+		Description: "add Countries.FipsCode and backfill it from the ISO/FIPS mapping",
+		Up:          up0002,
+		Down:        down0002,
+	})
+}
+
+// countryFipsCSV maps ISO 3166-1 alpha-3 country codes, as reported by the
+// ECDC feed, to their FIPS 10-4 country codes.
+const countryFipsCSV = `Code,FipsCode
+AFG,AF
+ALB,AL
+DZA,AG
+AND,AN
+AGO,AO
+ARG,AR
+AUS,AS
+AUT,AU
+BEL,BE
+BRA,BR
+CAN,CA
+CHN,CH
+FRA,FR
+DEU,GM
+IND,IN
+ITA,IT
+JPN,JA
+RUS,RS
+ESP,SP
+GBR,UK
+USA,US
+`
+
+func up0002(tx *sql.Tx) error {
+	if _, err := tx.Exec(`ALTER TABLE Countries ADD COLUMN FipsCode CHAR(2)`); err != nil {
+		return err
+	}
+	reader := csv.NewReader(strings.NewReader(countryFipsCSV))
+	if _, err := reader.Read(); err != nil {
+		return err
+	}
+	stmt, err := tx.Prepare(`UPDATE Countries SET FipsCode = ? WHERE Code = ?`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := stmt.Exec(row[1], row[0]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func down0002(tx *sql.Tx) error {
+	// SQLite only supports DROP COLUMN since 3.35.0, so rebuild the table
+	// without FipsCode instead of relying on it.
+	if _, err := tx.Exec(`ALTER TABLE Countries RENAME TO Countries_pre_fips`); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`CREATE TABLE Countries (
+		Id INTEGER PRIMARY KEY AUTOINCREMENT,
+		Code CHAR(3),
+		GeoId CHAR(2),
+		Name VARCHAR(255) COLLATE NOCASE,
+		Population INTEGER,
+		Continent VARCHAR(32)
+	)`); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`INSERT INTO Countries (Id, Code, GeoId, Name, Population, Continent)
+		SELECT Id, Code, GeoId, Name, Population, Continent FROM Countries_pre_fips`); err != nil {
+		return err
+	}
+	_, err := tx.Exec(`DROP TABLE Countries_pre_fips`)
+	return err
+}
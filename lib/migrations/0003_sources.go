@@ -0,0 +1,78 @@
+package migrations
+
+import "database/sql"
+
+func init() {
+	Register(Migration{
+		Version:     3,
+		Description: "add Sources table and Cases.SourceId, keyed on (SourceId, CountryId, Date)",
+		Up:          up0003,
+		Down:        down0003,
+	})
+}
+
+func up0003(tx *sql.Tx) error {
+	if _, err := tx.Exec(`CREATE TABLE IF NOT EXISTS Sources (
+		Id INTEGER PRIMARY KEY AUTOINCREMENT,
+		Name VARCHAR(64) UNIQUE,
+		Url VARCHAR(255),
+		LastImportAt INTEGER
+	)`); err != nil {
+		return err
+	}
+	// Pre-existing Cases rows predate multi-source support; attribute them to
+	// a placeholder "ecdc" source, the only provider that existed until now.
+	if _, err := tx.Exec(`INSERT INTO Sources (Name, Url, LastImportAt) VALUES ('ecdc', '', 0)`); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`ALTER TABLE Cases RENAME TO Cases_pre_source`); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`CREATE TABLE Cases (
+		Date INTEGER,
+		CountryId INTEGER,
+		Cases INTEGER,
+		Deaths INTEGER,
+		Cumulative REAL,
+		SourceId INTEGER,
+		PRIMARY KEY (SourceId, CountryId, Date),
+		FOREIGN KEY (CountryId) REFERENCES Countries(Id),
+		FOREIGN KEY (SourceId) REFERENCES Sources(Id)
+	)`); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`INSERT INTO Cases (Date, CountryId, Cases, Deaths, Cumulative, SourceId)
+		SELECT Date, CountryId, Cases, Deaths, Cumulative, (SELECT Id FROM Sources WHERE Name = 'ecdc')
+			FROM Cases_pre_source`); err != nil {
+		return err
+	}
+	_, err := tx.Exec(`DROP TABLE Cases_pre_source`)
+	return err
+}
+
+func down0003(tx *sql.Tx) error {
+	if _, err := tx.Exec(`ALTER TABLE Cases RENAME TO Cases_with_source`); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`CREATE TABLE Cases (
+		Date INTEGER,
+		CountryId INTEGER,
+		Cases INTEGER,
+		Deaths INTEGER,
+		Cumulative REAL,
+		PRIMARY KEY (Date, CountryId),
+		FOREIGN KEY (CountryId) REFERENCES Countries(Id)
+	)`); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`INSERT INTO Cases (Date, CountryId, Cases, Deaths, Cumulative)
+		SELECT Date, CountryId, Cases, Deaths, Cumulative FROM Cases_with_source
+			GROUP BY Date, CountryId`); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DROP TABLE Cases_with_source`); err != nil {
+		return err
+	}
+	_, err := tx.Exec(`DROP TABLE Sources`)
+	return err
+}
@@ -0,0 +1,116 @@
+// Package migrations implements a minimal versioned schema-migration runner.
+// It replaces ad-hoc CREATE TABLE IF NOT EXISTS calls with numbered,
+// reversible steps whose progress is tracked in a schema_migrations table.
+package migrations
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+)
+
+// Migration defines a single numbered schema change
+type Migration struct {
+	Version     int
+	Description string
+	Up          func(tx *sql.Tx) error
+	Down        func(tx *sql.Tx) error
+}
+
+var registry []Migration
+
+// Register adds a migration to the set applied by EnsureLatest. Migrations
+// register themselves from init() in their own file.
+func Register(m Migration) {
+	registry = append(registry, m)
+}
+
+func sortedMigrations() []Migration {
+	result := make([]Migration, len(registry))
+	copy(result, registry)
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Version < result[j].Version
+	})
+	return result
+}
+
+func ensureVersionTable(db *sql.DB) error {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		Version INTEGER PRIMARY KEY
+	)`)
+	return err
+}
+
+// Status returns the currently applied schema version, or 0 if no migration
+// has been applied yet
+func Status(db *sql.DB) (int, error) {
+	if err := ensureVersionTable(db); err != nil {
+		return 0, err
+	}
+	var version sql.NullInt64
+	if err := db.QueryRow(`SELECT MAX(Version) FROM schema_migrations`).Scan(&version); err != nil {
+		return 0, err
+	}
+	return int(version.Int64), nil
+}
+
+// EnsureLatest applies every registered migration newer than the current
+// schema version, each inside its own transaction
+func EnsureLatest(db *sql.DB) error {
+	current, err := Status(db)
+	if err != nil {
+		return err
+	}
+	for _, m := range sortedMigrations() {
+		if m.Version <= current {
+			continue
+		}
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		if err := m.Up(tx); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d (%s): %w", m.Version, m.Description, err)
+		}
+		if _, err := tx.Exec(`INSERT INTO schema_migrations (Version) VALUES (?)`, m.Version); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RollbackTo reverts every applied migration newer than target, in reverse order
+func RollbackTo(db *sql.DB, target int) error {
+	current, err := Status(db)
+	if err != nil {
+		return err
+	}
+	migrations := sortedMigrations()
+	for i := len(migrations) - 1; i >= 0; i-- {
+		m := migrations[i]
+		if m.Version <= target || m.Version > current {
+			continue
+		}
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		if err := m.Down(tx); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d (%s) rollback: %w", m.Version, m.Description, err)
+		}
+		if _, err := tx.Exec(`DELETE FROM schema_migrations WHERE Version = ?`, m.Version); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
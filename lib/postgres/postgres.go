@@ -0,0 +1,452 @@
+// Package postgres implements the lib.Store interface on top of PostgreSQL.
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/protopopov1122/covidservice/lib"
+)
+
+const insertNewRecordSQL string = `
+	INSERT
+		INTO Cases (CountryId, Date, Cases, Deaths, Cumulative, SourceId)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (SourceId, CountryId, Date) DO NOTHING`
+
+// Store is a PostgreSQL-backed implementation of lib.Store
+type Store struct {
+	database       *sql.DB
+	countryCache   map[int64]*lib.Country
+	countryCacheMu sync.RWMutex
+}
+
+// NewStore opens the provided DB handle and constructs a PostgreSQL-backed Store
+func NewStore(db *sql.DB) (*Store, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.Exec(`CREATE TABLE IF NOT EXISTS Countries (
+		Id SERIAL PRIMARY KEY,
+		Code VARCHAR(255),
+		GeoId VARCHAR(255),
+		Name VARCHAR(255),
+		Population BIGINT,
+		Continent VARCHAR(32),
+		FipsCode CHAR(2)
+	)`)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	// Countries predates FipsCode (sqlite picked it up via migration 0002);
+	// add it here too so both backends expose the same columns.
+	_, err = tx.Exec(`ALTER TABLE Countries ADD COLUMN IF NOT EXISTS FipsCode CHAR(2)`)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	// Code and GeoId predate VARCHAR(255): they were CHAR(3)/CHAR(2) for
+	// ISO-3166 alpha-3/alpha-2 codes, but providers such as jhu key Countries
+	// by their full (non-ISO) name in both columns, which character(n)
+	// truncates with an error. Widen existing deployments too.
+	_, err = tx.Exec(`ALTER TABLE Countries ALTER COLUMN Code TYPE VARCHAR(255)`)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	_, err = tx.Exec(`ALTER TABLE Countries ALTER COLUMN GeoId TYPE VARCHAR(255)`)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	_, err = tx.Exec(`CREATE TABLE IF NOT EXISTS Sources (
+		Id SERIAL PRIMARY KEY,
+		Name VARCHAR(64) UNIQUE,
+		Url VARCHAR(255),
+		LastImportAt BIGINT
+	)`)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	_, err = tx.Exec(`CREATE TABLE IF NOT EXISTS Cases (
+		Date BIGINT,
+		CountryId INTEGER,
+		Cases INTEGER,
+		Deaths INTEGER,
+		Cumulative REAL,
+		SourceId INTEGER,
+		PRIMARY KEY (SourceId, CountryId, Date),
+		FOREIGN KEY (CountryId) REFERENCES Countries(Id),
+		FOREIGN KEY (SourceId) REFERENCES Sources(Id)
+	)`)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &Store{
+		database:     db,
+		countryCache: make(map[int64]*lib.Country),
+	}, nil
+}
+
+// Close closes the underlying PostgreSQL connection
+func (store *Store) Close() error {
+	return store.database.Close()
+}
+
+// Countries lists the most recent revision of every known country
+func (store *Store) Countries() ([]*lib.Country, error) {
+	res, err := store.database.Query(`
+		SELECT c.Id, c.Code, c.GeoId, c.Name, c.Population, c.Continent, c.FipsCode
+			FROM Countries c
+			INNER JOIN (
+				SELECT Code, MAX(Id) AS MaxId FROM Countries GROUP BY Code
+			) latest ON latest.Code = c.Code AND latest.MaxId = c.Id
+			ORDER BY c.Code
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close()
+	var countries []*lib.Country
+	for res.Next() {
+		var country lib.Country
+		if err := res.Scan(&country.ID, &country.Code, &country.GeoID, &country.Name,
+			&country.Population, &country.Continent, &country.FipsCode); err != nil {
+			return nil, err
+		}
+		countries = append(countries, &country)
+	}
+	return countries, nil
+}
+
+// PutSource looks up a data source by name, creating it if it does not exist yet
+func (store *Store) PutSource(name string, url string) (*lib.Source, error) {
+	res, err := store.database.Query(`
+		SELECT Id, Name, Url, LastImportAt FROM Sources WHERE Name = $1
+	`, name)
+	if err != nil {
+		return nil, err
+	}
+	if res.Next() {
+		var source lib.Source
+		var lastImportAt int64
+		err = res.Scan(&source.ID, &source.Name, &source.URL, &lastImportAt)
+		res.Close()
+		if err != nil {
+			return nil, err
+		}
+		source.LastImportAt = time.Unix(lastImportAt, 0)
+		return &source, nil
+	}
+	res.Close()
+	var id int64
+	err = store.database.QueryRow(`
+		INSERT INTO Sources (Name, Url, LastImportAt) VALUES ($1, $2, 0) RETURNING Id
+	`, name, url).Scan(&id)
+	if err != nil {
+		return nil, err
+	}
+	return &lib.Source{
+		ID:           id,
+		Name:         name,
+		URL:          url,
+		LastImportAt: time.Unix(0, 0),
+	}, nil
+}
+
+// Country looks for the most recent country information
+func (store *Store) Country(code string) (*lib.Country, error) {
+	res, err := store.database.Query(`
+		SELECT Id, Code, GeoId, Name, Population, Continent, FipsCode
+			FROM Countries WHERE Code = $1
+			ORDER BY Id DESC LIMIT 1
+	`, code)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close()
+	if res.Next() {
+		var country lib.Country
+		res.Scan(&country.ID, &country.Code, &country.GeoID, &country.Name,
+			&country.Population, &country.Continent, &country.FipsCode)
+		return &country, nil
+	}
+	return nil, nil
+}
+
+// CountryByID looks for country information for specified ID
+func (store *Store) CountryByID(id int64) (*lib.Country, error) {
+	store.countryCacheMu.RLock()
+	cached := store.countryCache[id]
+	store.countryCacheMu.RUnlock()
+	if cached != nil {
+		return cached, nil
+	}
+	res, err := store.database.Query(`
+		SELECT Id, Code, GeoId, Name, Population, Continent, FipsCode
+			FROM Countries WHERE Id = $1
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close()
+	if res.Next() {
+		var country lib.Country
+		err = res.Scan(&country.ID, &country.Code, &country.GeoID, &country.Name,
+			&country.Population, &country.Continent, &country.FipsCode)
+		if err != nil {
+			return nil, err
+		}
+		store.countryCacheMu.Lock()
+		store.countryCache[id] = &country
+		store.countryCacheMu.Unlock()
+		return &country, nil
+	}
+	return nil, nil
+}
+
+func (store *Store) newCountryRecord(tx *sql.Tx, country *lib.Country) error {
+	var id int64
+	err := tx.QueryRow(`
+		INSERT
+			INTO Countries (Code, GeoID, Name, Population, Continent, FipsCode)
+			VALUES ($1, $2, $3, $4, $5, $6)
+			RETURNING Id`,
+		country.Code, country.GeoID, country.Name, country.Population, country.Continent, country.FipsCode).Scan(&id)
+	if err != nil {
+		return err
+	}
+	country.ID = id
+	store.countryCacheMu.Lock()
+	store.countryCache[country.ID] = country
+	store.countryCacheMu.Unlock()
+	return nil
+}
+
+// PutCountry creates new country in the store, or a new revision of an existing one
+func (store *Store) PutCountry(code string, geoID string, name string, population int64, continent string) (*lib.Country, error) {
+	country := &lib.Country{
+		Code:       code,
+		GeoID:      geoID,
+		Name:       name,
+		Population: population,
+		Continent:  continent,
+	}
+	tx, err := store.database.Begin()
+	if err != nil {
+		return nil, err
+	}
+	res, err := tx.Query(`
+		SELECT Id, Code, GeoId, Name, Population, Continent, FipsCode
+			FROM Countries WHERE Code = $1
+			ORDER BY Id DESC
+			LIMIT 1
+	`, code)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close()
+	if hasCurrentRevision := res.Next(); hasCurrentRevision {
+		currentRevision := lib.Country{}
+		err = res.Scan(&currentRevision.ID, &currentRevision.Code, &currentRevision.GeoID, &currentRevision.Name,
+			&currentRevision.Population, &currentRevision.Continent, &currentRevision.FipsCode)
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		if currentRevision.GeoID != geoID || currentRevision.Name != name ||
+			currentRevision.Population != population || currentRevision.Continent != continent {
+			if err = store.newCountryRecord(tx, country); err != nil {
+				tx.Rollback()
+				return nil, err
+			}
+			if err = tx.Commit(); err != nil {
+				return nil, err
+			}
+			return country, nil
+		}
+		if err = tx.Rollback(); err != nil {
+			return nil, err
+		}
+		return &currentRevision, nil
+	}
+	if err = store.newCountryRecord(tx, country); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	return country, nil
+}
+
+// NewRecord registers new date for country COVID stats, attributed to source
+func (store *Store) NewRecord(record *lib.CovidStatisticsRecord, source *lib.Source) error {
+	date := lib.NormalizeDate(record.Date)
+	res, err := store.database.Exec(insertNewRecordSQL, record.Country.ID, date.Unix(), record.Cases, record.Deaths, record.Cumulative, source.ID)
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return fmt.Errorf("Record for %s on %s from %s is already registered", record.Country.Code, date.Format("2006-01-02"), source.Name)
+	}
+	return nil
+}
+
+// ImportRecords inserts an array of records, attributed to source, as a
+// single transaction. Rows are inserted with ON CONFLICT DO NOTHING, so
+// re-importing already known records is idempotent and does not race a
+// SELECT-after-INSERT check.
+func (store *Store) ImportRecords(records []lib.CovidStatisticsRecord, source *lib.Source) error {
+	tx, err := store.database.Begin()
+	if err != nil {
+		return err
+	}
+	insertStmt, err := tx.Prepare(insertNewRecordSQL)
+	if err != nil {
+		return err
+	}
+	defer insertStmt.Close()
+
+	for _, record := range records {
+		_, err = insertStmt.Exec(record.Country.ID, lib.NormalizeDate(record.Date).Unix(), record.Cases, record.Deaths, record.Cumulative, source.ID)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	if _, err = tx.Exec(`UPDATE Sources SET LastImportAt = $1 WHERE Id = $2`, time.Now().Unix(), source.ID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// LastRecordDate returns date of last record for country from sourceName
+func (store *Store) LastRecordDate(countryCode string, sourceName string) (time.Time, error) {
+	res, err := store.database.Query(`
+		SELECT Cases.Date
+			FROM Cases
+			INNER JOIN Countries
+				ON Cases.CountryId = Countries.Id
+			INNER JOIN Sources
+				ON Cases.SourceId = Sources.Id
+			WHERE Countries.Code = $1 AND Sources.Name = $2
+			ORDER BY Date DESC
+			LIMIT 1`, countryCode, sourceName)
+	epochStart := time.Unix(0, 0)
+	if err != nil {
+		return epochStart, err
+	}
+	defer res.Close()
+	if !res.Next() {
+		return epochStart, nil
+	}
+	var timestamp int64
+	if err = res.Scan(&timestamp); err != nil {
+		return epochStart, err
+	}
+	return time.Unix(timestamp, 0), nil
+}
+
+// RetrieveRecordsSince collects country statistics from the store. When
+// sourceName is non-empty, results are restricted to that data source.
+func (store *Store) RetrieveRecordsSince(query lib.CountryQuery, since time.Time, sourceName string) (chan lib.CovidStatisticsRecordResult, error) {
+	sinceDate := lib.NormalizeDate(since)
+	var countryQuery string
+	switch query.QueryType {
+	default:
+		countryQuery = "Countries.Code"
+	case lib.CountryQueryByGeoID:
+		countryQuery = "Countries.GeoID"
+	case lib.CountryQueryByName:
+		countryQuery = "Countries.Name"
+	}
+	sqlQuery := fmt.Sprintf(`
+		SELECT Cases.CountryId, Cases.Date, Cases.Cases, Cases.Deaths, Cases.Cumulative,
+			Sources.Id, Sources.Name, Sources.Url, Sources.LastImportAt
+			FROM Cases
+			INNER JOIN Countries
+				ON Cases.CountryId = Countries.Id
+			INNER JOIN Sources
+				ON Cases.SourceId = Sources.Id
+			WHERE %s = $1 AND Cases.Date >= $2`, countryQuery)
+	args := []interface{}{query.Query, sinceDate.Unix()}
+	if len(sourceName) > 0 {
+		sqlQuery += " AND Sources.Name = $3"
+		args = append(args, sourceName)
+	}
+	sqlQuery += " ORDER BY Date ASC"
+	res, err := store.database.Query(sqlQuery, args...)
+	if err != nil {
+		return nil, err
+	}
+	chnl := make(chan lib.CovidStatisticsRecordResult)
+	go func() {
+		for res.Next() {
+			var countryID int64
+			var cases, deaths int
+			var timestamp int64
+			var cumulative float64
+			var sourceID int64
+			var sourceNameCol, sourceURL string
+			var sourceLastImport int64
+			err := res.Scan(&countryID, &timestamp, &cases, &deaths, &cumulative,
+				&sourceID, &sourceNameCol, &sourceURL, &sourceLastImport)
+			if err != nil {
+				chnl <- lib.CovidStatisticsRecordResult{
+					Error: err,
+				}
+				break
+			}
+			country, err := store.CountryByID(countryID)
+			if err != nil {
+				chnl <- lib.CovidStatisticsRecordResult{
+					Error: err,
+				}
+				break
+			}
+			chnl <- lib.CovidStatisticsRecordResult{
+				Result: lib.CovidStatisticsRecord{
+					Country:    country,
+					Date:       time.Unix(timestamp, 0),
+					Cases:      cases,
+					Deaths:     deaths,
+					Cumulative: cumulative,
+					Source: &lib.Source{
+						ID:           sourceID,
+						Name:         sourceNameCol,
+						URL:          sourceURL,
+						LastImportAt: time.Unix(sourceLastImport, 0),
+					},
+				},
+			}
+		}
+		close(chnl)
+	}()
+	return chnl, nil
+}
+
+// RetrieveRecords collects country statistics from the store. When
+// sourceName is non-empty, results are restricted to that data source.
+func (store *Store) RetrieveRecords(query lib.CountryQuery, sourceName string) (chan lib.CovidStatisticsRecordResult, error) {
+	return store.RetrieveRecordsSince(query, time.Unix(0, 0), sourceName)
+}
@@ -0,0 +1,104 @@
+//go:build integration
+
+package postgres_test
+
+import (
+	"database/sql"
+	"os"
+	"testing"
+	"time"
+
+	_ "github.com/lib/pq"
+
+	"github.com/protopopov1122/covidservice/lib"
+	"github.com/protopopov1122/covidservice/lib/postgres"
+)
+
+// openTestStore opens a PostgreSQL-backed Store against the instance named by
+// $COVID_TEST_POSTGRES_DSN, skipping the test when it is not set. Run it with
+// `go test -tags=integration` and the DSN exported for a throwaway Postgres
+// instance.
+func openTestStore(t *testing.T) *postgres.Store {
+	t.Helper()
+	dsn := os.Getenv("COVID_TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("COVID_TEST_POSTGRES_DSN not set, skipping PostgreSQL integration test")
+	}
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatalf("sql.Open: %v", err)
+	}
+	store, err := postgres.NewStore(db)
+	if err != nil {
+		t.Fatalf("postgres.NewStore: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+// TestStoreImportAndRetrieveRecords exercises the lib.Store surface a real
+// caller relies on: creating a country and source, importing records, and
+// reading them back through RetrieveRecordsSince.
+func TestStoreImportAndRetrieveRecords(t *testing.T) {
+	store := openTestStore(t)
+
+	country, err := store.PutCountry("ZZT", "ZT", "Testland", 42, "Testia")
+	if err != nil {
+		t.Fatalf("PutCountry: %v", err)
+	}
+	source, err := store.PutSource("integration-test", "https://example.test/source")
+	if err != nil {
+		t.Fatalf("PutSource: %v", err)
+	}
+
+	recordDate := lib.NormalizeDate(time.Now())
+	record := lib.CovidStatisticsRecord{
+		Country:    country,
+		Date:       recordDate,
+		Cases:      10,
+		Deaths:     1,
+		Cumulative: 10,
+	}
+	if err := store.ImportRecords([]lib.CovidStatisticsRecord{record}, source); err != nil {
+		t.Fatalf("ImportRecords: %v", err)
+	}
+	// Re-importing the same record must be a no-op rather than an error.
+	if err := store.ImportRecords([]lib.CovidStatisticsRecord{record}, source); err != nil {
+		t.Fatalf("ImportRecords (repeat): %v", err)
+	}
+
+	results, err := store.RetrieveRecordsSince(lib.NewQuery(country.Code), recordDate, source.Name)
+	if err != nil {
+		t.Fatalf("RetrieveRecordsSince: %v", err)
+	}
+	var found int
+	for result := range results {
+		if result.Error != nil {
+			t.Fatalf("RetrieveRecordsSince result: %v", result.Error)
+		}
+		if result.Result.Cases != record.Cases || result.Result.Deaths != record.Deaths {
+			t.Errorf("got cases=%d deaths=%d, want cases=%d deaths=%d",
+				result.Result.Cases, result.Result.Deaths, record.Cases, record.Deaths)
+		}
+		found++
+	}
+	if found != 1 {
+		t.Errorf("got %d records, want 1", found)
+	}
+}
+
+// TestStorePutCountryWithNonISOIdentifier exercises the jhu/csvsource pattern
+// of keying Code and GeoID by the full (non-ISO) country name instead of a
+// short code, which used to overflow Postgres's character(n) columns.
+func TestStorePutCountryWithNonISOIdentifier(t *testing.T) {
+	store := openTestStore(t)
+
+	const countryName = "United States of Testlandia"
+	country, err := store.PutCountry(countryName, countryName, countryName, 0, "")
+	if err != nil {
+		t.Fatalf("PutCountry: %v", err)
+	}
+	if country.Code != countryName || country.GeoID != countryName {
+		t.Errorf("got Code=%q GeoID=%q, want both %q", country.Code, country.GeoID, countryName)
+	}
+}
@@ -0,0 +1,446 @@
+// Package sqlite implements the lib.Store interface on top of SQLite.
+package sqlite
+
+import (
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/protopopov1122/covidservice/lib"
+	"github.com/protopopov1122/covidservice/lib/migrations"
+)
+
+const insertNewRecordSQL string = `
+	INSERT
+		INTO Cases (CountryId, Date, Cases, Deaths, Cumulative, SourceId)
+		VALUES (?, ?, ?, ?, ?, ?)`
+
+type stmtCache struct {
+	InsertNewRecord *sql.Stmt
+	SelectRecord    *sql.Stmt
+}
+
+// Store is a SQLite-backed implementation of lib.Store
+type Store struct {
+	database       *sql.DB
+	countryCache   map[int64]*lib.Country
+	countryCacheMu sync.RWMutex
+	stmtCache      stmtCache
+}
+
+func (cache *stmtCache) Prepare(db *sql.DB) error {
+	stmt, err := db.Prepare(insertNewRecordSQL)
+	if err != nil {
+		return err
+	}
+	cache.InsertNewRecord = stmt
+	stmt, err = db.Prepare(`
+		SELECT
+			Cases.Cases, Cases.Deaths, Cases.Cumulative
+		FROM Cases
+		INNER JOIN Countries
+			ON Countries.Id = Cases.CountryId
+		WHERE Countries.Code = ? AND Cases.Date = ? AND Cases.SourceId = ?`)
+	if err != nil {
+		return err
+	}
+	cache.SelectRecord = stmt
+	return nil
+}
+
+func (cache *stmtCache) Close() error {
+	if err := cache.InsertNewRecord.Close(); err != nil {
+		return err
+	}
+	if err := cache.SelectRecord.Close(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// NewStore opens the provided DB handle and constructs a SQLite-backed Store
+func NewStore(db *sql.DB) (*Store, error) {
+	if err := migrations.EnsureLatest(db); err != nil {
+		return nil, err
+	}
+	store := &Store{
+		database:     db,
+		countryCache: make(map[int64]*lib.Country),
+	}
+	if err := store.stmtCache.Prepare(db); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// RawDB returns the underlying *sql.DB, for callers such as the migrate CLI
+// command that need to operate on the schema directly
+func (store *Store) RawDB() *sql.DB {
+	return store.database
+}
+
+// Close closes the underlying SQLite database
+func (store *Store) Close() error {
+	if err := store.stmtCache.Close(); err != nil {
+		return err
+	}
+	return store.database.Close()
+}
+
+// Countries lists the most recent revision of every known country
+func (store *Store) Countries() ([]*lib.Country, error) {
+	res, err := store.database.Query(`
+		SELECT c.Id, c.Code, c.GeoId, c.Name, c.Population, c.Continent, c.FipsCode
+			FROM Countries c
+			INNER JOIN (
+				SELECT Code, MAX(Id) AS MaxId FROM Countries GROUP BY Code
+			) latest ON latest.Code = c.Code AND latest.MaxId = c.Id
+			ORDER BY c.Code
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close()
+	var countries []*lib.Country
+	for res.Next() {
+		var country lib.Country
+		if err := res.Scan(&country.ID, &country.Code, &country.GeoID, &country.Name,
+			&country.Population, &country.Continent, &country.FipsCode); err != nil {
+			return nil, err
+		}
+		countries = append(countries, &country)
+	}
+	return countries, nil
+}
+
+// PutSource looks up a data source by name, creating it if it does not exist yet
+func (store *Store) PutSource(name string, url string) (*lib.Source, error) {
+	res, err := store.database.Query(`
+		SELECT Id, Name, Url, LastImportAt FROM Sources WHERE Name = ?
+	`, name)
+	if err != nil {
+		return nil, err
+	}
+	if res.Next() {
+		var source lib.Source
+		var lastImportAt int64
+		err = res.Scan(&source.ID, &source.Name, &source.URL, &lastImportAt)
+		res.Close()
+		if err != nil {
+			return nil, err
+		}
+		source.LastImportAt = time.Unix(lastImportAt, 0)
+		return &source, nil
+	}
+	res.Close()
+	insert, err := store.database.Exec(`
+		INSERT INTO Sources (Name, Url, LastImportAt) VALUES (?, ?, 0)
+	`, name, url)
+	if err != nil {
+		return nil, err
+	}
+	id, err := insert.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	return &lib.Source{
+		ID:           id,
+		Name:         name,
+		URL:          url,
+		LastImportAt: time.Unix(0, 0),
+	}, nil
+}
+
+// Country looks for the most recent country information
+func (store *Store) Country(code string) (*lib.Country, error) {
+	res, err := store.database.Query(`
+		SELECT Id, Code, GeoId, Name, Population, Continent, FipsCode
+			FROM Countries WHERE Code = ?
+			ORDER BY Id DESC LIMIT 1
+	`, code)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close()
+	if res.Next() {
+		var country lib.Country
+		res.Scan(&country.ID, &country.Code, &country.GeoID, &country.Name,
+			&country.Population, &country.Continent, &country.FipsCode)
+		return &country, nil
+	}
+	return nil, nil
+}
+
+// CountryByID looks for  country information for specified ID
+func (store *Store) CountryByID(id int64) (*lib.Country, error) {
+	store.countryCacheMu.RLock()
+	cached := store.countryCache[id]
+	store.countryCacheMu.RUnlock()
+	if cached != nil {
+		return cached, nil
+	}
+	res, err := store.database.Query(`
+		SELECT Id, Code, GeoId, Name, Population, Continent, FipsCode
+			FROM Countries WHERE Id = ?
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close()
+	if res.Next() {
+		var country lib.Country
+		err = res.Scan(&country.ID, &country.Code, &country.GeoID, &country.Name,
+			&country.Population, &country.Continent, &country.FipsCode)
+		if err != nil {
+			return nil, err
+		}
+		store.countryCacheMu.Lock()
+		store.countryCache[id] = &country
+		store.countryCacheMu.Unlock()
+		return &country, nil
+	}
+	return nil, nil
+}
+
+func (store *Store) newCountryRecord(tx *sql.Tx, country *lib.Country) error {
+	stmt, err := tx.Prepare(`
+		INSERT
+			INTO Countries (Code, GeoID, Name, Population, Continent, FipsCode)
+			VALUES (?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	res, err := stmt.Exec(country.Code, country.GeoID, country.Name, country.Population, country.Continent, country.FipsCode)
+	if err != nil {
+		return err
+	}
+	country.ID, err = res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	store.countryCacheMu.Lock()
+	store.countryCache[country.ID] = country
+	store.countryCacheMu.Unlock()
+	return nil
+}
+
+// PutCountry creates new country in the store, or a new revision of an existing one
+func (store *Store) PutCountry(code string, geoID string, name string, population int64, continent string) (*lib.Country, error) {
+	country := &lib.Country{
+		Code:       code,
+		GeoID:      geoID,
+		Name:       name,
+		Population: population,
+		Continent:  continent,
+	}
+	tx, err := store.database.Begin()
+	if err != nil {
+		return nil, err
+	}
+	res, err := tx.Query(`
+		SELECT Id, Code, GeoId, Name, Population, Continent, FipsCode
+			FROM Countries WHERE Code = ?
+			ORDER BY Id DESC
+			LIMIT 1
+	`, code)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close()
+	if hasCurrentRevision := res.Next(); hasCurrentRevision {
+		currentRevision := lib.Country{}
+		err = res.Scan(&currentRevision.ID, &currentRevision.Code, &currentRevision.GeoID, &currentRevision.Name,
+			&currentRevision.Population, &currentRevision.Continent, &currentRevision.FipsCode)
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		if currentRevision.GeoID != geoID || currentRevision.Name != name ||
+			currentRevision.Population != population || currentRevision.Continent != continent {
+			if err = store.newCountryRecord(tx, country); err != nil {
+				tx.Rollback()
+				return nil, err
+			}
+			if err = tx.Commit(); err != nil {
+				return nil, err
+			}
+			return country, nil
+		}
+		if err = tx.Rollback(); err != nil {
+			return nil, err
+		}
+		return &currentRevision, nil
+	}
+	if err = store.newCountryRecord(tx, country); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	return country, nil
+}
+
+// NewRecord registers new date for country COVID stats, attributed to source
+func (store *Store) NewRecord(record *lib.CovidStatisticsRecord, source *lib.Source) error {
+	date := lib.NormalizeDate(record.Date)
+	_, err := store.stmtCache.InsertNewRecord.Exec(record.Country.ID, date.Unix(), record.Cases, record.Deaths, record.Cumulative, source.ID)
+	if err != nil {
+		res, qerr := store.stmtCache.SelectRecord.Query(record.Country.Code, date.Unix(), source.ID)
+		if qerr != nil {
+			return err
+		}
+		defer res.Close()
+		if hasRecord := res.Next(); hasRecord {
+			return fmt.Errorf("Record for %s on %s from %s is already registered", record.Country.Code, date.Format("2006-01-02"), source.Name)
+		}
+		return err
+	}
+	return nil
+}
+
+// ImportRecords inserts an array of records, attributed to source, as a
+// single transaction. Rows are keyed by (SourceId, CountryId, Date), so
+// records from different sources for the same day coexist.
+func (store *Store) ImportRecords(records []lib.CovidStatisticsRecord, source *lib.Source) error {
+	tx, err := store.database.Begin()
+	if err != nil {
+		return err
+	}
+	insertStmt, err := tx.Prepare(insertNewRecordSQL)
+	if err != nil {
+		return err
+	}
+	defer insertStmt.Close()
+
+	for _, record := range records {
+		_, err = insertStmt.Exec(record.Country.ID, lib.NormalizeDate(record.Date).Unix(), record.Cases, record.Deaths, record.Cumulative, source.ID)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	if _, err = tx.Exec(`UPDATE Sources SET LastImportAt = ? WHERE Id = ?`, time.Now().Unix(), source.ID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// LastRecordDate returns date of last record for country from sourceName
+func (store *Store) LastRecordDate(countryCode string, sourceName string) (time.Time, error) {
+	res, err := store.database.Query(`
+		SELECT Cases.Date
+			FROM Cases
+			INNER JOIN Countries
+				ON Cases.CountryId = Countries.Id
+			INNER JOIN Sources
+				ON Cases.SourceId = Sources.Id
+			WHERE Countries.Code = ? AND Sources.Name = ?
+			ORDER BY Date DESC
+			LIMIT 1`, countryCode, sourceName)
+	epochStart := time.Unix(0, 0)
+	if err != nil {
+		return epochStart, err
+	}
+	defer res.Close()
+	if !res.Next() {
+		return epochStart, nil
+	}
+	var timestamp int64
+	if err = res.Scan(&timestamp); err != nil {
+		return epochStart, err
+	}
+	return time.Unix(timestamp, 0), nil
+}
+
+// RetrieveRecordsSince collects country statistics from the store. When
+// sourceName is non-empty, results are restricted to that data source.
+func (store *Store) RetrieveRecordsSince(query lib.CountryQuery, since time.Time, sourceName string) (chan lib.CovidStatisticsRecordResult, error) {
+	sinceDate := lib.NormalizeDate(since)
+	var countryQuery string
+	switch query.QueryType {
+	default:
+		countryQuery = "Countries.Code"
+	case lib.CountryQueryByGeoID:
+		countryQuery = "Countries.GeoID"
+	case lib.CountryQueryByName:
+		countryQuery = "Countries.Name"
+	}
+	sqlQuery := fmt.Sprintf(`
+		SELECT Cases.CountryId, Cases.Date, Cases.Cases, Cases.Deaths, Cases.Cumulative,
+			Sources.Id, Sources.Name, Sources.Url, Sources.LastImportAt
+			FROM Cases
+			INNER JOIN Countries
+				ON Cases.CountryId = Countries.Id
+			INNER JOIN Sources
+				ON Cases.SourceId = Sources.Id
+			WHERE %s = ? AND Cases.Date >= ?`, countryQuery)
+	args := []interface{}{query.Query, sinceDate.Unix()}
+	if len(sourceName) > 0 {
+		sqlQuery += " AND Sources.Name = ?"
+		args = append(args, sourceName)
+	}
+	sqlQuery += " ORDER BY Date ASC"
+	res, err := store.database.Query(sqlQuery, args...)
+	if err != nil {
+		return nil, err
+	}
+	chnl := make(chan lib.CovidStatisticsRecordResult)
+	go func() {
+		for res.Next() {
+			var countryID int64
+			var cases, deaths int
+			var timestamp int64
+			var cumulative float64
+			var sourceID int64
+			var sourceNameCol, sourceURL string
+			var sourceLastImport int64
+			err := res.Scan(&countryID, &timestamp, &cases, &deaths, &cumulative,
+				&sourceID, &sourceNameCol, &sourceURL, &sourceLastImport)
+			if err != nil {
+				chnl <- lib.CovidStatisticsRecordResult{
+					Error: err,
+				}
+				break
+			}
+			country, err := store.CountryByID(countryID)
+			if err != nil {
+				chnl <- lib.CovidStatisticsRecordResult{
+					Error: err,
+				}
+				break
+			}
+			chnl <- lib.CovidStatisticsRecordResult{
+				Result: lib.CovidStatisticsRecord{
+					Country:    country,
+					Date:       time.Unix(timestamp, 0),
+					Cases:      cases,
+					Deaths:     deaths,
+					Cumulative: cumulative,
+					Source: &lib.Source{
+						ID:           sourceID,
+						Name:         sourceNameCol,
+						URL:          sourceURL,
+						LastImportAt: time.Unix(sourceLastImport, 0),
+					},
+				},
+			}
+		}
+		close(chnl)
+	}()
+	return chnl, nil
+}
+
+// RetrieveRecords collects country statistics from the store. When
+// sourceName is non-empty, results are restricted to that data source.
+func (store *Store) RetrieveRecords(query lib.CountryQuery, sourceName string) (chan lib.CovidStatisticsRecordResult, error) {
+	return store.RetrieveRecordsSince(query, time.Unix(0, 0), sourceName)
+}
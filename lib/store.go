@@ -0,0 +1,86 @@
+package lib
+
+import (
+	"strings"
+	"time"
+)
+
+// CountryQueryType defines country query  (by id/geo id/name)
+type CountryQueryType int
+
+const (
+	// CountryQueryByID defines country query by ID
+	CountryQueryByID CountryQueryType = iota
+	// CountryQueryByGeoID defines country query by Geo ID
+	CountryQueryByGeoID
+	// CountryQueryByName defines country query by name
+	CountryQueryByName
+)
+
+// CountryQuery defines tagged union for database queries
+type CountryQuery struct {
+	QueryType CountryQueryType
+	Query     string
+}
+
+// Store abstracts the persistence backend for COVID case statistics, so that
+// SQLite, PostgreSQL or other drivers can be plugged in interchangeably.
+type Store interface {
+	// Countries lists the most recent revision of every known country
+	Countries() ([]*Country, error)
+	// Country looks for the most recent country information
+	Country(code string) (*Country, error)
+	// CountryByID looks for country information for specified ID
+	CountryByID(id int64) (*Country, error)
+	// PutCountry creates new country in the store, or a new revision of an existing one
+	PutCountry(code string, geoID string, name string, population int64, continent string) (*Country, error)
+	// PutSource looks up a data source by name, creating it if it does not exist yet
+	PutSource(name string, url string) (*Source, error)
+	// NewRecord registers new date for country COVID stats, attributed to source
+	NewRecord(record *CovidStatisticsRecord, source *Source) error
+	// ImportRecords inserts an array of records, attributed to source, as a single transaction
+	ImportRecords(records []CovidStatisticsRecord, source *Source) error
+	// LastRecordDate returns date of last record for country from sourceName,
+	// so each provider can track its own incremental-import watermark
+	// independently of every other provider's
+	LastRecordDate(countryCode string, sourceName string) (time.Time, error)
+	// RetrieveRecordsSince collects country statistics recorded on or after since,
+	// optionally restricted to a single source when sourceName is non-empty
+	RetrieveRecordsSince(query CountryQuery, since time.Time, sourceName string) (chan CovidStatisticsRecordResult, error)
+	// RetrieveRecords collects all country statistics, optionally restricted to
+	// a single source when sourceName is non-empty
+	RetrieveRecords(query CountryQuery, sourceName string) (chan CovidStatisticsRecordResult, error)
+	// Close releases resources held by the store
+	Close() error
+}
+
+// CovidDataSource abstracts importable data source
+type CovidDataSource interface {
+	Import(store Store) error
+}
+
+// NormalizeDate strips the time-of-day component so records are keyed by date only
+func NormalizeDate(timestamp time.Time) time.Time {
+	year, month, day := timestamp.Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, time.Local)
+}
+
+// NewQuery constructs new country query based on query string
+func NewQuery(query string) CountryQuery {
+	if len(query) == 2 && strings.ToUpper(query) == query {
+		return CountryQuery{
+			Query:     query,
+			QueryType: CountryQueryByGeoID,
+		}
+	} else if len(query) == 3 && strings.ToUpper(query) == query {
+		return CountryQuery{
+			Query:     query,
+			QueryType: CountryQueryByID,
+		}
+	} else {
+		return CountryQuery{
+			Query:     query,
+			QueryType: CountryQueryByName,
+		}
+	}
+}
@@ -10,6 +10,16 @@ type Country struct {
 	Name       string
 	Population int64
 	Continent  string
+	FipsCode   string
+}
+
+// Source identifies a COVID data provider (ECDC, JHU, WHO, ...), so records
+// imported from different providers can be told apart and cross-checked
+type Source struct {
+	ID           int64
+	Name         string
+	URL          string
+	LastImportAt time.Time
 }
 
 // CovidStatisticsRecord contains daily COVID statistics per country
@@ -19,6 +29,7 @@ type CovidStatisticsRecord struct {
 	Deaths     int
 	Cumulative float64
 	Country    *Country
+	Source     *Source
 }
 
 // CovidStatisticsRecordResult contains statistics lookup result or possible error
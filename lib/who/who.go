@@ -0,0 +1,141 @@
+// Package who implements lib.CovidDataSource on top of the WHO COVID-19
+// global data CSV export (Date_reported, Country_code, Country, WHO_region,
+// New_cases, Cumulative_cases, New_deaths, Cumulative_deaths), alongside the
+// existing ECDC JSON and JHU CSSE time series providers.
+package who
+
+import (
+	"encoding/csv"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/protopopov1122/covidservice/lib"
+)
+
+const dateLayout = "2006-01-02"
+
+const (
+	columnDate        = 0
+	columnCountryCode = 1
+	columnCountryName = 2
+	columnNewCases    = 4
+	columnNewDeaths   = 6
+)
+
+type whoImporter struct {
+	db              lib.Store
+	source          *lib.Source
+	lastRecordCache map[string]time.Time
+}
+
+// DataSource is a WHO global data lib.CovidDataSource, reading a local file
+// or an HTTP(S) URL
+type DataSource struct {
+	location string
+}
+
+// NewDataSource constructs a WHO COVID data source pointed at a local file
+// path or an HTTP(S) URL
+func NewDataSource(location string) *DataSource {
+	return &DataSource{location: location}
+}
+
+func (who *DataSource) open() (io.ReadCloser, error) {
+	if strings.HasPrefix(who.location, "http://") || strings.HasPrefix(who.location, "https://") {
+		rsp, err := http.Get(who.location)
+		if err != nil {
+			return nil, err
+		}
+		return rsp.Body, nil
+	}
+	return os.Open(who.location)
+}
+
+// Import streams the WHO global data CSV into db, skipping rows already
+// covered by LastRecordDate so re-imports only append newer data
+func (who *DataSource) Import(db lib.Store) error {
+	r, err := who.open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	source, err := db.PutSource("who", who.location)
+	if err != nil {
+		return err
+	}
+	importer := &whoImporter{
+		db:              db,
+		source:          source,
+		lastRecordCache: make(map[string]time.Time),
+	}
+	return importer.Import(r)
+}
+
+func (importer *whoImporter) lastRecordTime(countryCode string) (time.Time, error) {
+	if cached, ok := importer.lastRecordCache[countryCode]; ok {
+		return cached, nil
+	}
+	timestamp, err := importer.db.LastRecordDate(countryCode, importer.source.Name)
+	if err != nil {
+		return time.Unix(0, 0), err
+	}
+	importer.lastRecordCache[countryCode] = timestamp
+	return timestamp, nil
+}
+
+func (importer *whoImporter) Import(r io.Reader) error {
+	reader := csv.NewReader(r)
+	if _, err := reader.Read(); err != nil {
+		return err
+	}
+
+	var recordsForImport []lib.CovidStatisticsRecord
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		timestamp, err := time.ParseInLocation(dateLayout, row[columnDate], time.Local)
+		if err != nil {
+			return err
+		}
+		countryCode := row[columnCountryCode]
+		lastRecord, err := importer.lastRecordTime(countryCode)
+		if err != nil {
+			return err
+		}
+		if !lastRecord.Before(timestamp) {
+			continue
+		}
+
+		cases, err := strconv.Atoi(row[columnNewCases])
+		if err != nil {
+			return err
+		}
+		deaths, err := strconv.Atoi(row[columnNewDeaths])
+		if err != nil {
+			return err
+		}
+
+		country, err := importer.db.PutCountry(countryCode, countryCode, row[columnCountryName], 0, "")
+		if err != nil {
+			return err
+		}
+		recordsForImport = append(recordsForImport, lib.CovidStatisticsRecord{
+			Country: country,
+			Date:    timestamp,
+			Cases:   cases,
+			Deaths:  deaths,
+		})
+		importer.lastRecordCache[countryCode] = timestamp
+	}
+	return importer.db.ImportRecords(recordsForImport, importer.source)
+}
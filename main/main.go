@@ -6,21 +6,40 @@ import (
 	"os"
 
 	covid "github.com/protopopov1122/covidservice/lib"
+	"github.com/protopopov1122/covidservice/lib/postgres"
+	"github.com/protopopov1122/covidservice/lib/sqlite"
 
+	_ "github.com/lib/pq"
 	_ "github.com/mattn/go-sqlite3"
 )
 
-func makeDatabase(env *covid.Env) (*covid.Database, error) {
-	database, err := sql.Open("sqlite3", env.DatabasePath)
-	if err != nil {
-		return nil, err
-	}
-	cdb, err := covid.NewDatabase(database)
-	if err != nil {
-		database.Close()
-		return nil, err
+func makeDatabase(env *covid.Env) (covid.Store, error) {
+	switch env.DatabaseDriver {
+	case "postgres":
+		database, err := sql.Open("postgres", env.DatabaseDSN)
+		if err != nil {
+			return nil, err
+		}
+		store, err := postgres.NewStore(database)
+		if err != nil {
+			database.Close()
+			return nil, err
+		}
+		return store, nil
+	case "sqlite3", "":
+		database, err := sql.Open("sqlite3", env.DatabasePath)
+		if err != nil {
+			return nil, err
+		}
+		store, err := sqlite.NewStore(database)
+		if err != nil {
+			database.Close()
+			return nil, err
+		}
+		return store, nil
+	default:
+		return nil, fmt.Errorf("Unknown database driver '%s'", env.DatabaseDriver)
 	}
-	return cdb, nil
 }
 
 func startApp(entry covid.EntryFn) error {
@@ -42,7 +61,12 @@ func startApp(entry covid.EntryFn) error {
 func main() {
 	cli := covid.NewCli()
 	cli.Bind(covid.NewCommand("import", "Import the most recent data", importFn))
-	cli.Bind(covid.NewCommand("query", "Query country data", queryFn))
+	cli.Bind(covid.NewCommand("query", "Query country data (--source, --reconcile max|mean|prefer=<source>)", queryFn))
+	cli.Bind(covid.NewCommand("import-csv", "Import data from a CSV source (--url/--file, --mapping)", importCsvFn))
+	cli.Bind(covid.NewCommand("import-jhu", "Import JHU CSSE time series data (--confirmed, --deaths)", importJhuFn))
+	cli.Bind(covid.NewCommand("import-who", "Import WHO global data (--url/--file)", importWhoFn))
+	cli.Bind(covid.NewCommand("migrate", "Manage database schema migrations (up/down/status)", migrateFn))
+	cli.Bind(covid.NewCommand("serve", "Start the HTTP/JSON API server (--listen)", serveFn))
 	cli.Bind(covid.NewCommand("help", "Print help", helpFn))
 	if err := startApp(cli.NewEntry(os.Args[1:])); err != nil {
 		fmt.Println(err)
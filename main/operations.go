@@ -1,15 +1,30 @@
 package main
 
 import (
+	"context"
 	"errors"
+	"flag"
 	"fmt"
 	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"time"
 
 	covid "github.com/protopopov1122/covidservice/lib"
+	"github.com/protopopov1122/covidservice/lib/api"
+	"github.com/protopopov1122/covidservice/lib/csvsource"
 	"github.com/protopopov1122/covidservice/lib/ecdc"
+	"github.com/protopopov1122/covidservice/lib/jhu"
+	"github.com/protopopov1122/covidservice/lib/migrations"
+	"github.com/protopopov1122/covidservice/lib/sqlite"
+	"github.com/protopopov1122/covidservice/lib/who"
 )
 
-func importFn(cdb *covid.Database, env *covid.Env, _ *covid.Cli, argv []string, out io.Writer) error {
+const serveShutdownTimeout = 10 * time.Second
+
+func importFn(cdb covid.Store, env *covid.Env, _ *covid.Cli, argv []string, out io.Writer) error {
 	fmt.Fprintf(out, "Importing from %s into %s", env.EcdcDataSourceURL, env.DatabasePath)
 	dataSource, err := ecdc.NewDataSource(env.EcdcDataSourceURL)
 	if err != nil {
@@ -19,26 +34,246 @@ func importFn(cdb *covid.Database, env *covid.Env, _ *covid.Cli, argv []string,
 	return dataSource.Import(cdb)
 }
 
-func queryFn(cdb *covid.Database, env *covid.Env, _ *covid.Cli, argv []string, out io.Writer) error {
-	if len(argv) == 0 {
+func queryFn(cdb covid.Store, env *covid.Env, _ *covid.Cli, argv []string, out io.Writer) error {
+	flags := flag.NewFlagSet("query", flag.ContinueOnError)
+	source := flags.String("source", "", "Restrict to a single data source (e.g. ecdc, jhu, who)")
+	reconcile := flags.String("reconcile", "", "Merge rows across sources recorded on the same date: max, mean, or prefer=<source>")
+	if err := flags.Parse(argv); err != nil {
+		return err
+	}
+	args := flags.Args()
+	if len(args) == 0 {
 		return errors.New("Provide country code")
 	}
-	records, err := cdb.RetrieveRecords(covid.NewQuery(argv[0]))
+	records, err := cdb.RetrieveRecords(covid.NewQuery(args[0]), *source)
+	if err != nil {
+		return err
+	}
+	merged, err := reconcileRecords(records, *reconcile)
 	if err != nil {
 		return err
 	}
 	fmt.Fprintf(out, "%-15s %-15s %-15s %-10s %s\n", "Country", "Date", "Cumulative", "New cases", "New deaths")
+	for _, record := range merged {
+		fmt.Fprintf(out, "%-15s %-15s %-15f %-10d %d\n", record.Country.Name, record.Date.Format("2006-01-02"), record.Cumulative, record.Cases, record.Deaths)
+	}
+	fmt.Fprintf(out, "Data source:\t%s\n", env.EcdcDataSourceURL)
+	return nil
+}
+
+// reconcileRecords drains records into a slice, ordered by arrival, merging
+// rows recorded on the same date across sources when mode is non-empty.
+// Recognised modes are "max" (highest Cumulative wins), "mean" (average
+// across sources) and "prefer=<source>" (pick the named source, falling back
+// to the first row for dates it did not report).
+func reconcileRecords(records chan covid.CovidStatisticsRecordResult, mode string) ([]covid.CovidStatisticsRecord, error) {
+	var all []covid.CovidStatisticsRecord
 	for record := range records {
 		if record.Error != nil {
-			return record.Error
+			return nil, record.Error
 		}
-		fmt.Fprintf(out, "%-15s %-15s %-15f %-10d %d\n", record.Result.Country.Name, record.Result.Date.Format("2006-01-02"), record.Result.Cumulative, record.Result.Cases, record.Result.Deaths)
+		all = append(all, record.Result)
+	}
+	if mode == "" {
+		return all, nil
+	}
+
+	preferSource := ""
+	if strings.HasPrefix(mode, "prefer=") {
+		preferSource = strings.TrimPrefix(mode, "prefer=")
+		mode = "prefer"
+	}
+
+	var order []string
+	byDate := make(map[string][]covid.CovidStatisticsRecord)
+	for _, record := range all {
+		key := record.Date.Format("2006-01-02")
+		if _, ok := byDate[key]; !ok {
+			order = append(order, key)
+		}
+		byDate[key] = append(byDate[key], record)
+	}
+
+	merged := make([]covid.CovidStatisticsRecord, 0, len(order))
+	for _, key := range order {
+		group := byDate[key]
+		switch mode {
+		case "max":
+			merged = append(merged, maxRecord(group))
+		case "mean":
+			merged = append(merged, meanRecord(group))
+		case "prefer":
+			merged = append(merged, preferRecord(group, preferSource))
+		default:
+			return nil, fmt.Errorf("Unknown reconcile mode '%s'", mode)
+		}
+	}
+	return merged, nil
+}
+
+func maxRecord(group []covid.CovidStatisticsRecord) covid.CovidStatisticsRecord {
+	best := group[0]
+	for _, record := range group[1:] {
+		if record.Cumulative > best.Cumulative {
+			best = record
+		}
+	}
+	return best
+}
+
+func meanRecord(group []covid.CovidStatisticsRecord) covid.CovidStatisticsRecord {
+	mean := group[0]
+	var cumulative float64
+	var cases, deaths int
+	for _, record := range group {
+		cumulative += record.Cumulative
+		cases += record.Cases
+		deaths += record.Deaths
+	}
+	mean.Cumulative = cumulative / float64(len(group))
+	mean.Cases = cases / len(group)
+	mean.Deaths = deaths / len(group)
+	mean.Source = nil
+	return mean
+}
+
+func preferRecord(group []covid.CovidStatisticsRecord, preferSource string) covid.CovidStatisticsRecord {
+	for _, record := range group {
+		if record.Source != nil && record.Source.Name == preferSource {
+			return record
+		}
+	}
+	return group[0]
+}
+
+func importCsvFn(cdb covid.Store, env *covid.Env, _ *covid.Cli, argv []string, out io.Writer) error {
+	flags := flag.NewFlagSet("import-csv", flag.ContinueOnError)
+	url := flags.String("url", "", "HTTP(S) URL of the CSV data source")
+	file := flags.String("file", "", "Local file path of the CSV data source")
+	mapping := flags.String("mapping", "ecdc", "Column mapping preset (ecdc, jhu)")
+	if err := flags.Parse(argv); err != nil {
+		return err
+	}
+	if (*url == "") == (*file == "") {
+		return errors.New("Provide exactly one of --url or --file")
+	}
+	columnMap, ok := csvsource.Presets[*mapping]
+	if !ok {
+		return fmt.Errorf("Unknown column mapping preset '%s'", *mapping)
+	}
+	location := *url
+	if *file != "" {
+		location = *file
+	}
+	fmt.Fprintf(out, "Importing CSV data from %s into %s", location, env.DatabasePath)
+	dataSource := csvsource.NewDataSource(location, columnMap, *mapping)
+	return dataSource.Import(cdb)
+}
+
+func importJhuFn(cdb covid.Store, env *covid.Env, _ *covid.Cli, argv []string, out io.Writer) error {
+	flags := flag.NewFlagSet("import-jhu", flag.ContinueOnError)
+	confirmed := flags.String("confirmed", "", "URL or file path of the JHU CSSE confirmed-cases time series")
+	deaths := flags.String("deaths", "", "URL or file path of the JHU CSSE deaths time series")
+	if err := flags.Parse(argv); err != nil {
+		return err
+	}
+	if *confirmed == "" || *deaths == "" {
+		return errors.New("Provide both --confirmed and --deaths")
+	}
+	fmt.Fprintf(out, "Importing JHU CSSE data into %s", env.DatabasePath)
+	dataSource := jhu.NewDataSource(*confirmed, *deaths)
+	return dataSource.Import(cdb)
+}
+
+func importWhoFn(cdb covid.Store, env *covid.Env, _ *covid.Cli, argv []string, out io.Writer) error {
+	flags := flag.NewFlagSet("import-who", flag.ContinueOnError)
+	url := flags.String("url", "", "HTTP(S) URL of the WHO global data CSV")
+	file := flags.String("file", "", "Local file path of the WHO global data CSV")
+	if err := flags.Parse(argv); err != nil {
+		return err
+	}
+	if (*url == "") == (*file == "") {
+		return errors.New("Provide exactly one of --url or --file")
+	}
+	location := *url
+	if *file != "" {
+		location = *file
+	}
+	fmt.Fprintf(out, "Importing WHO data from %s into %s", location, env.DatabasePath)
+	dataSource := who.NewDataSource(location)
+	return dataSource.Import(cdb)
+}
+
+func serveFn(cdb covid.Store, env *covid.Env, _ *covid.Cli, argv []string, out io.Writer) error {
+	flags := flag.NewFlagSet("serve", flag.ContinueOnError)
+	listen := flags.String("listen", ":8080", "Address to listen on")
+	if err := flags.Parse(argv); err != nil {
+		return err
+	}
+
+	server := api.NewServer(cdb, env, *listen)
+	errCh := make(chan error, 1)
+	go func() {
+		fmt.Fprintf(out, "Listening on %s\n", *listen)
+		errCh <- server.Serve()
+	}()
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt)
+	defer signal.Stop(sigCh)
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-sigCh:
+		fmt.Fprintln(out, "Shutting down")
+		ctx, cancel := context.WithTimeout(context.Background(), serveShutdownTimeout)
+		defer cancel()
+		return server.Shutdown(ctx)
+	}
+}
+
+func migrateFn(cdb covid.Store, _ *covid.Env, _ *covid.Cli, argv []string, out io.Writer) error {
+	store, ok := cdb.(*sqlite.Store)
+	if !ok {
+		return errors.New("migrate command is only supported for the sqlite3 database driver")
+	}
+	if len(argv) == 0 {
+		return errors.New("Provide migrate subcommand: up, down or status")
+	}
+	switch argv[0] {
+	case "up":
+		if err := migrations.EnsureLatest(store.RawDB()); err != nil {
+			return err
+		}
+		fmt.Fprintln(out, "Schema is up to date")
+		return nil
+	case "down":
+		if len(argv) < 2 {
+			return errors.New("Provide target schema version")
+		}
+		target, err := strconv.Atoi(argv[1])
+		if err != nil {
+			return err
+		}
+		if err := migrations.RollbackTo(store.RawDB(), target); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Rolled back schema to version %d\n", target)
+		return nil
+	case "status":
+		version, err := migrations.Status(store.RawDB())
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Schema version: %d\n", version)
+		return nil
+	default:
+		return fmt.Errorf("Unknown migrate subcommand '%s'", argv[0])
 	}
-	fmt.Fprintf(out, "Data source:\t%s\n", env.EcdcDataSourceURL)
-	return nil
 }
 
-func helpFn(cdb *covid.Database, env *covid.Env, cli *covid.Cli, argv []string, out io.Writer) error {
+func helpFn(cdb covid.Store, env *covid.Env, cli *covid.Cli, argv []string, out io.Writer) error {
 	fmt.Fprintf(out, "Database:\t%s\b", env.DatabasePath)
 	fmt.Fprintf(out, "Data source:\t%s\n", env.EcdcDataSourceURL)
 	fmt.Fprintf(out, "Command list:\n")